@@ -0,0 +1,116 @@
+package argon2
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrCalibrationFailed is returned by CalibrateParams if no Memory/Iterations
+// combination tried landed within tolerance of the target duration before the
+// attempt budget was exhausted or Memory reached its 8*parallelism KiB floor.
+var ErrCalibrationFailed = errors.New("argon2: calibration failed to converge on target duration")
+
+const (
+	// calibrateTolerance is how close, as a fraction of target, an observed
+	// run needs to land before CalibrateParams accepts it. Scheduler/GC
+	// jitter is absorbed by averaging calibrateSamples runs per attempt
+	// rather than by widening this window.
+	calibrateTolerance = 0.10
+
+	// calibrateMaxAttempts bounds how many benchmark runs CalibrateParams
+	// will try before giving up. Halving Memory from a large maxMemory down
+	// to the 8*parallelism floor can itself take close to a dozen attempts,
+	// so this needs enough headroom left over to then fine-tune Iterations.
+	calibrateMaxAttempts = 30
+
+	// calibrateSamples is how many timed hashes CalibrateParams averages per
+	// attempt. A single wall-clock sample is noisy enough (scheduler jitter,
+	// GC pauses) to flake against calibrateTolerance; averaging several
+	// steadies it without materially slowing calibration down.
+	calibrateSamples = 3
+
+	// calibrateMaxIterations caps how far the proportional scale-up in
+	// CalibrateParams is allowed to raise Iterations in one step. Without a
+	// ceiling, a very fast observed sample (plausible with a small maxMemory
+	// on fast hardware) divides target by a near-zero duration and can ask
+	// the next attempt to run an enormous number of Argon2 passes.
+	calibrateMaxIterations = 1000
+)
+
+// CalibrateParams benchmarks IDKey (this package's own Argon2id implementation,
+// see argon2_core.go) on the current machine and returns a
+// *Params combination that derives a key within roughly 10% of target,
+// without using more than maxMemory KiB, using parallelism lanes. observed
+// is the average duration of the benchmark run that was ultimately accepted.
+//
+// It starts at Memory=maxMemory, Iterations=1 and times calibrateSamples
+// hashes. If that run is faster than target, Iterations is scaled up
+// proportionally (capped at calibrateMaxIterations) and retried. If it's
+// slower, Memory is halved and Iterations reset to 1 before retrying.
+// CalibrateParams gives up and returns ErrCalibrationFailed once
+// calibrateMaxAttempts runs have been tried without landing in tolerance, or
+// earlier if a run is still too slow once Memory is at or below the
+// 8*parallelism KiB floor.
+//
+// This operationalizes the RFC recommendation that DefaultParams documents
+// but doesn't itself apply: deployers should pick Argon2 work factors per
+// machine rather than hardcoding one fixed set of parameters. Call
+// CalibrateParams once at startup and use the resulting *Params for
+// CreateHash, IDCreateHash or a configured Hasher.
+func CalibrateParams(target time.Duration, maxMemory uint32, parallelism uint8) (params *Params, observed time.Duration, err error) {
+	salt, err := generateRandomBytes(16)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	memory := maxMemory
+	var iterations uint32 = 1
+
+	lower := time.Duration(float64(target) * (1 - calibrateTolerance))
+	upper := time.Duration(float64(target) * (1 + calibrateTolerance))
+
+	for attempt := 0; attempt < calibrateMaxAttempts; attempt++ {
+		var total time.Duration
+		for s := 0; s < calibrateSamples; s++ {
+			start := time.Now()
+			_ = IDKey([]byte("argon2-calibration-password"), salt, iterations, memory, parallelism, 32)
+			total += time.Since(start)
+		}
+		observed = total / calibrateSamples
+
+		if observed >= lower && observed <= upper {
+			return &Params{
+				Memory:      memory,
+				Iterations:  iterations,
+				Parallelism: parallelism,
+				SaltLength:  16,
+				KeyLength:   32,
+			}, observed, nil
+		}
+
+		if observed < lower {
+			if observed <= 0 {
+				iterations = calibrateMaxIterations
+			} else {
+				scaled := float64(iterations) * float64(target) / float64(observed)
+				if scaled > calibrateMaxIterations {
+					iterations = calibrateMaxIterations
+				} else if scaled < 1 {
+					iterations = 1
+				} else {
+					iterations = uint32(scaled)
+				}
+			}
+			continue
+		}
+
+		// observed > upper: too slow at this memory size.
+		if memory <= 8*uint32(parallelism) {
+			break
+		}
+		memory /= 2
+		iterations = 1
+	}
+
+	return nil, observed, ErrCalibrationFailed
+}
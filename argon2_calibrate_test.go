@@ -0,0 +1,33 @@
+package argon2
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalibrateParams(t *testing.T) {
+	// A larger target gives the wall-clock measurement more absolute
+	// slack to absorb a fixed amount of scheduler/GC jitter before that
+	// jitter eats into calibrateTolerance.
+	target := 50 * time.Millisecond
+
+	params, observed, err := CalibrateParams(target, 8*1024, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params == nil {
+		t.Fatal("expected non-nil params")
+	}
+	if params.Parallelism != 1 {
+		t.Errorf("expected parallelism 1, got %d", params.Parallelism)
+	}
+	if observed <= 0 {
+		t.Error("expected a positive observed duration")
+	}
+
+	lower := time.Duration(float64(target) * (1 - calibrateTolerance))
+	upper := time.Duration(float64(target) * (1 + calibrateTolerance))
+	if observed < lower || observed > upper {
+		t.Errorf("observed duration %v outside tolerance of target %v", observed, target)
+	}
+}
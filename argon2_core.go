@@ -0,0 +1,325 @@
+package argon2
+
+// This file ports the core Argon2 key derivation routines from
+// golang.org/x/crypto/argon2 (https://cs.opensource.google/go/x/crypto),
+// adding an Argon2d entry point and secret/associated-data-aware variants
+// that the upstream package does not expose.
+/*
+Copyright 2017 The Go Authors. All rights reserved.
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file.
+*/
+
+import (
+	"encoding/binary"
+	"hash"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Version is the Argon2 version implemented by this package.
+const Version = 0x13
+
+const (
+	modeArgon2d = iota
+	modeArgon2i
+	modeArgon2id
+)
+
+const (
+	blockLength = 128
+	syncPoints  = 4
+)
+
+type block [blockLength]uint64
+
+// Key derives a key from the password, salt, and cost parameters using
+// Argon2i, returning a byte slice of length keyLen that can be used as a
+// cryptographic key. The CPU cost and parallelism degree must be greater
+// than zero.
+func Key(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return deriveKeyCore(modeArgon2i, password, salt, nil, nil, time, memory, threads, keyLen)
+}
+
+// KeyWithSecret is Key with an additional secret ("pepper") mixed into the
+// derivation. The secret is not stored alongside the hash and must be
+// supplied again on every verification.
+func KeyWithSecret(password, secret, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return deriveKeyCore(modeArgon2i, password, salt, secret, nil, time, memory, threads, keyLen)
+}
+
+// KeyExtended is KeyWithSecret with associated data mixed into the
+// derivation. keyID is not fed into the KDF: it is PHC string metadata only,
+// used to identify which secret was used, and is recorded by the caller.
+func KeyExtended(password, secret, salt, keyID, associatedData []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	_ = keyID
+	return deriveKeyCore(modeArgon2i, password, salt, secret, associatedData, time, memory, threads, keyLen)
+}
+
+// IDKey derives a key from the password, salt, and cost parameters using
+// Argon2id, returning a byte slice of length keyLen that can be used as a
+// cryptographic key. The CPU cost and parallelism degree must be greater
+// than zero.
+func IDKey(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return deriveKeyCore(modeArgon2id, password, salt, nil, nil, time, memory, threads, keyLen)
+}
+
+// IDKeyWithSecret is IDKey with an additional secret ("pepper") mixed into
+// the derivation. The secret is not stored alongside the hash and must be
+// supplied again on every verification.
+func IDKeyWithSecret(password, secret, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return deriveKeyCore(modeArgon2id, password, salt, secret, nil, time, memory, threads, keyLen)
+}
+
+// IDKeyExtended is IDKeyWithSecret with associated data mixed into the
+// derivation. keyID is not fed into the KDF: it is PHC string metadata only,
+// used to identify which secret was used, and is recorded by the caller.
+func IDKeyExtended(password, secret, salt, keyID, associatedData []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	_ = keyID
+	return deriveKeyCore(modeArgon2id, password, salt, secret, associatedData, time, memory, threads, keyLen)
+}
+
+// DKey derives a key from the password, salt, and cost parameters using
+// Argon2d, returning a byte slice of length keyLen that can be used as a
+// cryptographic key. Argon2d uses data-dependent memory addressing, which
+// gives it a higher resistance to GPU cracking attacks than Argon2i at the
+// cost of side-channel resistance; it is only appropriate when side-channel
+// attacks are not a concern. The CPU cost and parallelism degree must be
+// greater than zero.
+func DKey(password, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return deriveKeyCore(modeArgon2d, password, salt, nil, nil, time, memory, threads, keyLen)
+}
+
+// DKeyWithSecret is DKey with an additional secret ("pepper") mixed into the
+// derivation. The secret is not stored alongside the hash and must be
+// supplied again on every verification.
+func DKeyWithSecret(password, secret, salt []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	return deriveKeyCore(modeArgon2d, password, salt, secret, nil, time, memory, threads, keyLen)
+}
+
+// DKeyExtended is DKeyWithSecret with associated data mixed into the
+// derivation. keyID is not fed into the KDF: it is PHC string metadata only,
+// used to identify which secret was used, and is recorded by the caller.
+func DKeyExtended(password, secret, salt, keyID, associatedData []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	_ = keyID
+	return deriveKeyCore(modeArgon2d, password, salt, secret, associatedData, time, memory, threads, keyLen)
+}
+
+func deriveKeyCore(mode int, password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	if time < 1 {
+		panic("argon2: number of rounds too small")
+	}
+	if threads < 1 {
+		panic("argon2: parallelism degree too low")
+	}
+	h0 := initHash(password, salt, secret, data, time, memory, uint32(threads), keyLen, mode)
+
+	memory = memory / (syncPoints * uint32(threads)) * (syncPoints * uint32(threads))
+	if memory < 2*syncPoints*uint32(threads) {
+		memory = 2 * syncPoints * uint32(threads)
+	}
+	B := initBlocks(&h0, memory, uint32(threads))
+	processBlocks(B, time, memory, uint32(threads), mode)
+	return extractKey(B, memory, uint32(threads), keyLen)
+}
+
+func initHash(password, salt, key, data []byte, time, memory, threads, keyLen uint32, mode int) [blake2b.Size + 8]byte {
+	var (
+		h0     [blake2b.Size + 8]byte
+		params [24]byte
+		tmp    [4]byte
+	)
+
+	b2, _ := blake2b.New512(nil)
+	binary.LittleEndian.PutUint32(params[0:4], threads)
+	binary.LittleEndian.PutUint32(params[4:8], keyLen)
+	binary.LittleEndian.PutUint32(params[8:12], memory)
+	binary.LittleEndian.PutUint32(params[12:16], time)
+	binary.LittleEndian.PutUint32(params[16:20], uint32(Version))
+	binary.LittleEndian.PutUint32(params[20:24], uint32(mode))
+	b2.Write(params[:])
+	binary.LittleEndian.PutUint32(tmp[:], uint32(len(password)))
+	b2.Write(tmp[:])
+	b2.Write(password)
+	binary.LittleEndian.PutUint32(tmp[:], uint32(len(salt)))
+	b2.Write(tmp[:])
+	b2.Write(salt)
+	binary.LittleEndian.PutUint32(tmp[:], uint32(len(key)))
+	b2.Write(tmp[:])
+	b2.Write(key)
+	binary.LittleEndian.PutUint32(tmp[:], uint32(len(data)))
+	b2.Write(tmp[:])
+	b2.Write(data)
+	b2.Sum(h0[:0])
+	return h0
+}
+
+func initBlocks(h0 *[blake2b.Size + 8]byte, memory, threads uint32) []block {
+	var block0 [1024]byte
+	B := make([]block, memory)
+	for lane := uint32(0); lane < threads; lane++ {
+		j := lane * (memory / threads)
+		binary.LittleEndian.PutUint32(h0[blake2b.Size+4:], lane)
+
+		binary.LittleEndian.PutUint32(h0[blake2b.Size:], 0)
+		blake2bHash(block0[:], h0[:])
+		for i := range B[j+0] {
+			B[j+0][i] = binary.LittleEndian.Uint64(block0[i*8:])
+		}
+
+		binary.LittleEndian.PutUint32(h0[blake2b.Size:], 1)
+		blake2bHash(block0[:], h0[:])
+		for i := range B[j+1] {
+			B[j+1][i] = binary.LittleEndian.Uint64(block0[i*8:])
+		}
+	}
+	return B
+}
+
+func processBlocks(B []block, time, memory, threads uint32, mode int) {
+	lanes := memory / threads
+	segments := lanes / syncPoints
+
+	processSegment := func(n, slice, lane uint32, wg *sync.WaitGroup) {
+		var addresses, in, zero block
+		if mode == modeArgon2i || (mode == modeArgon2id && n == 0 && slice < syncPoints/2) {
+			in[0] = uint64(n)
+			in[1] = uint64(lane)
+			in[2] = uint64(slice)
+			in[3] = uint64(memory)
+			in[4] = uint64(time)
+			in[5] = uint64(mode)
+		}
+
+		index := uint32(0)
+		if n == 0 && slice == 0 {
+			index = 2 // we have already generated the first two blocks
+			if mode == modeArgon2i || mode == modeArgon2id {
+				in[6]++
+				processBlock(&addresses, &in, &zero)
+				processBlock(&addresses, &addresses, &zero)
+			}
+		}
+
+		offset := lane*lanes + slice*segments + index
+		var random uint64
+		for index < segments {
+			prev := offset - 1
+			if index == 0 && slice == 0 {
+				prev += lanes // last block in lane
+			}
+			if mode == modeArgon2i || (mode == modeArgon2id && n == 0 && slice < syncPoints/2) {
+				if index%blockLength == 0 {
+					in[6]++
+					processBlock(&addresses, &in, &zero)
+					processBlock(&addresses, &addresses, &zero)
+				}
+				random = addresses[index%blockLength]
+			} else {
+				random = B[prev][0]
+			}
+			newOffset := indexAlpha(random, lanes, segments, threads, n, slice, lane, index)
+			processBlockXOR(&B[offset], &B[prev], &B[newOffset])
+			index, offset = index+1, offset+1
+		}
+		wg.Done()
+	}
+
+	for n := uint32(0); n < time; n++ {
+		for slice := uint32(0); slice < syncPoints; slice++ {
+			var wg sync.WaitGroup
+			for lane := uint32(0); lane < threads; lane++ {
+				wg.Add(1)
+				go processSegment(n, slice, lane, &wg)
+			}
+			wg.Wait()
+		}
+	}
+}
+
+func extractKey(B []block, memory, threads, keyLen uint32) []byte {
+	lanes := memory / threads
+	for lane := uint32(0); lane < threads-1; lane++ {
+		for i, v := range B[(lane*lanes)+lanes-1] {
+			B[memory-1][i] ^= v
+		}
+	}
+
+	var blk [1024]byte
+	for i, v := range B[memory-1] {
+		binary.LittleEndian.PutUint64(blk[i*8:], v)
+	}
+	key := make([]byte, keyLen)
+	blake2bHash(key, blk[:])
+	return key
+}
+
+func indexAlpha(rand uint64, lanes, segments, threads, n, slice, lane, index uint32) uint32 {
+	refLane := uint32(rand>>32) % threads
+	if n == 0 && slice == 0 {
+		refLane = lane
+	}
+	m, s := 3*segments, ((slice+1)%syncPoints)*segments
+	if lane == refLane {
+		m += index
+	}
+	if n == 0 {
+		m, s = slice*segments, 0
+		if slice == 0 || lane == refLane {
+			m += index
+		}
+	}
+	if index == 0 || lane == refLane {
+		m--
+	}
+	return phi(rand, uint64(m), uint64(s), refLane, lanes)
+}
+
+func phi(rand, m, s uint64, lane, lanes uint32) uint32 {
+	p := rand & 0xFFFFFFFF
+	p = (p * p) >> 32
+	p = (p * m) >> 32
+	return lane*lanes + uint32((s+m-(p+1))%uint64(lanes))
+}
+
+// blake2bHash computes an arbitrary long hash value of in and writes the
+// hash to out.
+func blake2bHash(out []byte, in []byte) {
+	var b2 hash.Hash
+	if n := len(out); n < blake2b.Size {
+		b2, _ = blake2b.New(n, nil)
+	} else {
+		b2, _ = blake2b.New512(nil)
+	}
+
+	var buffer [blake2b.Size]byte
+	binary.LittleEndian.PutUint32(buffer[:4], uint32(len(out)))
+	b2.Write(buffer[:4])
+	b2.Write(in)
+
+	if len(out) <= blake2b.Size {
+		b2.Sum(out[:0])
+		return
+	}
+
+	outLen := len(out)
+	b2.Sum(buffer[:0])
+	b2.Reset()
+	copy(out, buffer[:32])
+	out = out[32:]
+	for len(out) > blake2b.Size {
+		b2.Write(buffer[:])
+		b2.Sum(buffer[:0])
+		copy(out, buffer[:32])
+		out = out[32:]
+		b2.Reset()
+	}
+
+	if outLen%blake2b.Size > 0 { // outLen > 64
+		r := ((outLen + 31) / 32) - 2 // ceil(outLen/32) - 2
+		b2, _ = blake2b.New(outLen-32*r, nil)
+	}
+	b2.Write(buffer[:])
+	b2.Sum(out[:0])
+}
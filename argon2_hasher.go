@@ -0,0 +1,152 @@
+package argon2
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrInvalidMemory is returned by NewHasher if Memory is lower than
+	// 8*Parallelism KiB, the minimum the Argon2 RFC permits per lane.
+	ErrInvalidMemory = errors.New("argon2: memory must be at least 8*parallelism kibibytes")
+
+	// ErrInvalidIterations is returned by NewHasher if Iterations is lower than 1.
+	ErrInvalidIterations = errors.New("argon2: iterations must be at least 1")
+
+	// ErrInvalidParallelism is returned by NewHasher if Parallelism is lower than 1.
+	ErrInvalidParallelism = errors.New("argon2: parallelism must be at least 1")
+
+	// ErrInvalidSaltLength is returned by NewHasher if SaltLength is lower than 8 bytes.
+	ErrInvalidSaltLength = errors.New("argon2: salt length must be at least 8 bytes")
+
+	// ErrInvalidKeyLength is returned by NewHasher if KeyLength is lower than 4 bytes.
+	ErrInvalidKeyLength = errors.New("argon2: key length must be at least 4 bytes")
+)
+
+// Hasher bundles a set of Params together with a Secret (pepper) so that an
+// application can build one pre-validated Hasher at startup and share it
+// across every call site, rather than threading secret and *Params through
+// every CreateHash/CheckHash call individually.
+//
+// Use NewHasher to construct a Hasher; its parameters are validated once at
+// construction time instead of on every Hash/Verify/Rehash call.
+type Hasher struct {
+	Params *Params
+	Secret []byte
+}
+
+// NewHasher validates params and returns a Hasher that uses them, along with
+// secret as the pepper, for every subsequent Hash, Verify and Rehash call. It
+// returns one of the Err* sentinel errors in this file if a parameter falls
+// outside the safe range for Argon2.
+func NewHasher(params *Params, secret []byte) (*Hasher, error) {
+	if err := validateParams(params); err != nil {
+		return nil, err
+	}
+	return &Hasher{Params: params, Secret: secret}, nil
+}
+
+func validateParams(params *Params) error {
+	if params.Memory < 8*uint32(params.Parallelism) {
+		return ErrInvalidMemory
+	}
+	if params.Iterations < 1 {
+		return ErrInvalidIterations
+	}
+	if params.Parallelism < 1 {
+		return ErrInvalidParallelism
+	}
+	if params.SaltLength < 8 {
+		return ErrInvalidSaltLength
+	}
+	if params.KeyLength < 4 {
+		return ErrInvalidKeyLength
+	}
+	return nil
+}
+
+// Hash derives an Argon2id hash of password using h.Params and h.Secret, in
+// the same format produced by IDCreateHash. The intermediate password and
+// derived key buffers are zeroed before Hash returns, so they don't linger
+// on the heap any longer than necessary.
+func (h *Hasher) Hash(password string) (hash string, err error) {
+	salt, err := generateRandomBytes(h.Params.SaltLength)
+	if err != nil {
+		return "", err
+	}
+
+	pwd := []byte(password)
+	defer zero(pwd)
+
+	key := computeKey(Argon2id, pwd, h.Secret, salt, h.Params)
+	defer zero(key)
+
+	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
+	b64Key := base64.RawStdEncoding.EncodeToString(key)
+
+	hash = fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", Version, formatParamsSegment(h.Params), b64Salt, b64Key)
+	return hash, nil
+}
+
+// Verify reports whether password matches hash, deriving the comparison key
+// with h.Secret. Unlike Hash, which always produces Argon2id, Verify accepts
+// a hash created with any variant this package supports (Argon2i, Argon2id
+// or Argon2d). The intermediate password and derived key buffers are zeroed
+// before Verify returns.
+func (h *Hasher) Verify(password, hash string) (match bool, err error) {
+	argon2Variant, params, salt, key, err := DecodeHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	pwd := []byte(password)
+	defer zero(pwd)
+
+	otherKey := computeKey(argon2Variant, pwd, h.Secret, salt, params)
+	defer zero(otherKey)
+
+	keyLen := int32(len(key))
+	otherKeyLen := int32(len(otherKey))
+
+	if subtle.ConstantTimeEq(keyLen, otherKeyLen) == 0 {
+		return false, nil
+	}
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+// Rehash reports whether password matches hash and, when it does, whether
+// hash was created with parameters weaker than h.Params. If a rehash is
+// needed it returns a freshly computed Argon2id hash using h.Params;
+// newHash is empty whenever no rehash is necessary or password didn't match.
+func (h *Hasher) Rehash(password, hash string) (match bool, newHash string, err error) {
+	match, err = h.Verify(password, hash)
+	if err != nil || !match {
+		return match, "", err
+	}
+
+	needsRehash, err := NeedsRehash(hash, h.Params)
+	if err != nil {
+		return true, "", err
+	}
+	if !needsRehash {
+		return true, "", nil
+	}
+
+	newHash, err = h.Hash(password)
+	if err != nil {
+		return true, "", err
+	}
+	return true, newHash, nil
+}
+
+// zero overwrites b with zero bytes. It is a defense-in-depth measure that
+// reduces the time sensitive key material spends resident in memory; it
+// cannot guarantee that earlier copies made by the Go runtime (e.g. during
+// slice growth) are also scrubbed.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
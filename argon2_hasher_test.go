@@ -0,0 +1,107 @@
+package argon2
+
+import "testing"
+
+func TestNewHasherValidation(t *testing.T) {
+	base := *DefaultParams
+
+	tests := []struct {
+		name    string
+		mutate  func(p *Params)
+		wantErr error
+	}{
+		{"low memory", func(p *Params) { p.Memory = 4; p.Parallelism = 1 }, ErrInvalidMemory},
+		{"no iterations", func(p *Params) { p.Iterations = 0 }, ErrInvalidIterations},
+		{"no parallelism", func(p *Params) { p.Parallelism = 0 }, ErrInvalidParallelism},
+		{"short salt", func(p *Params) { p.SaltLength = 4 }, ErrInvalidSaltLength},
+		{"short key", func(p *Params) { p.KeyLength = 2 }, ErrInvalidKeyLength},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := base
+			tt.mutate(&params)
+			if _, err := NewHasher(&params, nil); err != tt.wantErr {
+				t.Fatalf("expected %v got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if _, err := NewHasher(&base, nil); err != nil {
+		t.Fatalf("expected valid params to construct a Hasher, got %v", err)
+	}
+}
+
+func TestHasherHashAndVerify(t *testing.T) {
+	hasher, err := NewHasher(DefaultParams, []byte("$â‚¬crâ‚¬t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := hasher.Hash("pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, err := hasher.Verify("pa$$word", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("expected password and hash to match")
+	}
+
+	match, err = hasher.Verify("otherPa$$word", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Error("expected password and hash to not match")
+	}
+}
+
+func TestHasherRehash(t *testing.T) {
+	weakParams := &Params{
+		Memory:      16 * 1024,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+
+	weakHasher, err := NewHasher(weakParams, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash, err := weakHasher.Hash("pa$$word")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hasher, err := NewHasher(DefaultParams, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, newHash, err := hasher.Rehash("pa$$word", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Fatal("expected password and hash to match")
+	}
+	if newHash == "" {
+		t.Fatal("expected a rehash using the stronger params")
+	}
+
+	match, newHash, err = hasher.Rehash("pa$$word", newHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Fatal("expected password and hash to match")
+	}
+	if newHash != "" {
+		t.Error("expected no rehash once params already meet desired")
+	}
+}
@@ -33,8 +33,6 @@ import (
 	"errors"
 	"fmt"
 	"strings"
-
-	"golang.org/x/crypto/argon2"
 )
 
 var (
@@ -43,8 +41,8 @@ var (
 	ErrInvalidHash = errors.New("argon2: hash is not in the correct format")
 
 	// ErrIncompatibleVariant is returned by ComparePasswordAndHash if the
-	// provided hash was created using a unsupported variant of Argon2.
-	// Currently only argon2id is supported by this package.
+	// provided hash was created using an unrecognized variant identifier.
+	// argon2i, argon2id and argon2d are all supported by this package.
 	ErrIncompatibleVariant = errors.New("argon2: incompatible variant of argon2")
 
 	// ErrIncompatibleVersion is returned by ComparePasswordAndHash if the
@@ -52,6 +50,47 @@ var (
 	ErrIncompatibleVersion = errors.New("argon2: incompatible version of argon2")
 )
 
+// Variant identifies which of the three Argon2 addressing modes was used to
+// derive a key. It replaces the package's former unexported int constants so
+// that callers outside the package (e.g. code inspecting the variant that
+// DecodeHash returns) can name a variant explicitly.
+type Variant int
+
+const (
+	// Argon2i uses data-independent memory access, which is the best choice
+	// for password hashing and password-based key derivation since it
+	// provides the strongest resistance against side-channel attacks.
+	Argon2i Variant = iota
+	// Argon2id is a hybrid that uses data-independent addressing for the
+	// first pass over memory and data-dependent addressing for subsequent
+	// passes. This is the RECOMMENDED variant for most applications.
+	Argon2id
+	// Argon2d uses data-dependent memory access. It is faster than Argon2i
+	// and Argon2id and provides greater resistance against GPU cracking
+	// attacks, but is vulnerable to side-channel timing attacks, so it
+	// should only be used where there is no threat of such attacks (e.g.
+	// cryptocurrency proof-of-work schemes).
+	Argon2d
+
+	// invalidVariant is returned by DecodeHash when the variant segment of
+	// a hash cannot be identified.
+	invalidVariant Variant = -1
+)
+
+// String returns the PHC identifier used for this variant, e.g. "argon2id".
+func (v Variant) String() string {
+	switch v {
+	case Argon2i:
+		return "argon2i"
+	case Argon2id:
+		return "argon2id"
+	case Argon2d:
+		return "argon2d"
+	default:
+		return "unknown"
+	}
+}
+
 // DefaultParams provides some sane default parameters for hashing passwords.
 //
 // Follows recommendations given by the Argon2 RFC:
@@ -98,6 +137,73 @@ type Params struct {
 
 	// Length of the generated key. 16 bytes or more is recommended.
 	KeyLength uint32
+
+	// KeyID optionally identifies which secret was used to derive the hash,
+	// so that a pepper can be rotated without invalidating hashes created
+	// with an earlier one (the application looks up the right secret by
+	// KeyID when verifying). It's encoded as the PHC "keyid" field. Leave it
+	// nil to omit the field, which is the common case.
+	KeyID []byte
+
+	// AssociatedData is mixed into the key derivation, e.g. a user ID or
+	// tenant ID, so the resulting key is only reproduced with the same
+	// context. It's stored base64-encoded, and so recoverable, as the PHC
+	// "data" field. Leave it nil to omit the field, which is the common
+	// case.
+	AssociatedData []byte
+}
+
+// formatParamsSegment renders the "m=...,t=...,p=..." segment of a PHC hash
+// string, appending the optional "keyid=" and "data=" fields when params
+// carries a KeyID or AssociatedData.
+func formatParamsSegment(params *Params) string {
+	segment := fmt.Sprintf("m=%d,t=%d,p=%d", params.Memory, params.Iterations, params.Parallelism)
+	if len(params.KeyID) > 0 {
+		segment += ",keyid=" + base64.RawStdEncoding.EncodeToString(params.KeyID)
+	}
+	if len(params.AssociatedData) > 0 {
+		segment += ",data=" + base64.RawStdEncoding.EncodeToString(params.AssociatedData)
+	}
+	return segment
+}
+
+// computeKey derives the key for variant using password, secret and salt,
+// plus params.KeyID/params.AssociatedData if set. When neither is set it
+// calls the plain Key/KeyWithSecret family so that hashes without AD are
+// byte-for-byte identical to what this package has always produced; when
+// either is set it routes through the Extended family, which mixes
+// AssociatedData into the underlying Argon2 call. KeyID is passed along but
+// not mixed into the derivation: it only travels in the PHC string.
+func computeKey(variant Variant, password, secret, salt []byte, params *Params) []byte {
+	extended := len(params.KeyID) > 0 || len(params.AssociatedData) > 0
+
+	switch variant {
+	case Argon2i:
+		if extended {
+			return KeyExtended(password, secret, salt, params.KeyID, params.AssociatedData, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		}
+		if len(secret) == 0 {
+			return Key(password, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		}
+		return KeyWithSecret(password, secret, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	case Argon2id:
+		if extended {
+			return IDKeyExtended(password, secret, salt, params.KeyID, params.AssociatedData, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		}
+		if len(secret) == 0 {
+			return IDKey(password, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		}
+		return IDKeyWithSecret(password, secret, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	case Argon2d:
+		if extended {
+			return DKeyExtended(password, secret, salt, params.KeyID, params.AssociatedData, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		}
+		if len(secret) == 0 {
+			return DKey(password, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+		}
+		return DKeyWithSecret(password, secret, salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	}
+	return nil
 }
 
 // CreateHash generates an Argon2i password hash using the provided password, secret,
@@ -121,24 +227,23 @@ type Params struct {
 // by the salt and parameters. It looks like this:
 //
 //	$argon2i$v=19$m=65536,t=1,p=2$Ell6DALdx5M3PMaNxPsFyA$VTeuPaGQW621unpzV0zHKT8S4xRir8djGSY63vsYb7U
+//
+// If params.KeyID or params.AssociatedData is set, they are base64-encoded
+// into "keyid=" and "data=" fields appended to the parameter segment, e.g.
+//
+//	$argon2i$v=19$m=65536,t=1,p=2,keyid=Zm9v$Ell6DALdx5M3PMaNxPsFyA$VTeuPaGQW621unpzV0zHKT8S4xRir8djGSY63vsYb7U
 func CreateHash(password, secret string, params *Params) (hash string, err error) {
 	salt, err := generateRandomBytes(params.SaltLength)
 	if err != nil {
 		return "", err
 	}
 
-	var key []byte
-	if secret == "" {
-		key = Key([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
-	}
-	if secret != "" {
-		key = KeyWithSecret([]byte(password), []byte(secret), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
-	}
+	key := computeKey(Argon2i, []byte(password), []byte(secret), salt, params)
 
 	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
 	b64Key := base64.RawStdEncoding.EncodeToString(key)
 
-	hash = fmt.Sprintf("$argon2i$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, params.Memory, params.Iterations, params.Parallelism, b64Salt, b64Key)
+	hash = fmt.Sprintf("$argon2i$v=%d$%s$%s$%s", Version, formatParamsSegment(params), b64Salt, b64Key)
 	return hash, nil
 }
 
@@ -163,24 +268,66 @@ func CreateHash(password, secret string, params *Params) (hash string, err error
 // by the salt and parameters. It looks like this:
 //
 //	$argon2id$v=19$m=65536,t=1,p=2$FmIYUI9SfLj+xHJJsM3JXw$DI8bBB2wHgOFwWVXXUSjmwRMeh/1pVVu5PDbsjoFtYE
+//
+// If params.KeyID or params.AssociatedData is set, they are base64-encoded
+// into "keyid=" and "data=" fields appended to the parameter segment, e.g.
+//
+//	$argon2id$v=19$m=65536,t=1,p=2,data=dXNlci00Mg$FmIYUI9SfLj+xHJJsM3JXw$DI8bBB2wHgOFwWVXXUSjmwRMeh/1pVVu5PDbsjoFtYE
 func IDCreateHash(password, secret string, params *Params) (hash string, err error) {
 	salt, err := generateRandomBytes(params.SaltLength)
 	if err != nil {
 		return
 	}
 
-	var key []byte
-	if secret == "" {
-		key = IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
-	}
-	if secret != "" {
-		key = IDKeyWithSecret([]byte(password), []byte(secret), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	key := computeKey(Argon2id, []byte(password), []byte(secret), salt, params)
+
+	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
+	b64Key := base64.RawStdEncoding.EncodeToString(key)
+
+	hash = fmt.Sprintf("$argon2id$v=%d$%s$%s$%s", Version, formatParamsSegment(params), b64Salt, b64Key)
+	return hash, nil
+}
+
+// DCreateHash generates an Argon2d password hash using the provided password, secret,
+// and parameters. It returns the generated hash as a string and any error encountered.
+//
+// Argon2d uses data-dependent memory access, which makes it faster than Argon2i
+// and Argon2id and resistant to GPU cracking attacks, at the cost of being
+// vulnerable to side-channel timing attacks. It is intended for applications
+// with no threat of such attacks, and for interop with other libraries (e.g.
+// the Argon2 reference implementation or hlandau/passlib) that emit argon2d
+// hashes.
+//
+// Parameters:
+//   - password: The user's password.
+//   - secret: An additional secret used for key derivation.
+//   - params: A Params struct containing key derivation parameters.
+//
+// Returns:
+//   - hash: The generated Argon2d password hash.
+//   - err: Any error encountered during hash generation.
+//
+// The returned hash follows the format used by the Argon2 reference C
+// implementation and contains the base64-encoded Argon2d derived key prefixed
+// by the salt and parameters. It looks like this:
+//
+//	$argon2d$v=19$m=65536,t=1,p=2$Ell6DALdx5M3PMaNxPsFyA$VTeuPaGQW621unpzV0zHKT8S4xRir8djGSY63vsYb7U
+//
+// If params.KeyID or params.AssociatedData is set, they are base64-encoded
+// into "keyid=" and "data=" fields appended to the parameter segment, in the
+// same way as CreateHash and IDCreateHash.
+func DCreateHash(password, secret string, params *Params) (hash string, err error) {
+	salt, err := generateRandomBytes(params.SaltLength)
+	if err != nil {
+		return "", err
 	}
 
+	key := computeKey(Argon2d, []byte(password), []byte(secret), salt, params)
+
 	b64Salt := base64.RawStdEncoding.EncodeToString(salt)
 	b64Key := base64.RawStdEncoding.EncodeToString(key)
 
-	hash = fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", Version, params.Memory, params.Iterations, params.Parallelism, b64Salt, b64Key)
+	hash = fmt.Sprintf("$argon2d$v=%d$%s$%s$%s", Version, formatParamsSegment(params), b64Salt, b64Key)
 	return hash, nil
 }
 
@@ -202,23 +349,7 @@ func CheckHash(password, secret, hash string) (match bool, params *Params, err e
 		return false, nil, err
 	}
 
-	var otherKey []byte
-	if argon2Variant == argon2i {
-		if secret == "" {
-			otherKey = Key([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
-		}
-		if secret != "" {
-			otherKey = KeyWithSecret([]byte(password), []byte(secret), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
-		}
-	}
-	if argon2Variant == argon2id {
-		if secret == "" {
-			otherKey = IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
-		}
-		if secret != "" {
-			otherKey = IDKeyWithSecret([]byte(password), []byte(secret), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
-		}
-	}
+	otherKey := computeKey(argon2Variant, []byte(password), []byte(secret), salt, params)
 
 	keyLen := int32(len(key))
 	otherKeyLen := int32(len(otherKey))
@@ -232,25 +363,90 @@ func CheckHash(password, secret, hash string) (match bool, params *Params, err e
 	return false, params, nil
 }
 
+// NeedsRehash reports whether hash was created with parameters weaker than desired,
+// meaning the password should be re-hashed with desired the next time it's available
+// in plaintext (typically right after a successful login). It compares memory,
+// iterations, parallelism, salt length and key length; a hash is considered to need
+// rehashing if any of these falls short of the corresponding field in desired.
+func NeedsRehash(hash string, desired *Params) (bool, error) {
+	_, params, _, _, err := DecodeHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	if params.Memory < desired.Memory ||
+		params.Iterations < desired.Iterations ||
+		params.Parallelism < desired.Parallelism ||
+		params.SaltLength < desired.SaltLength ||
+		params.KeyLength < desired.KeyLength {
+		return true, nil
+	}
+	return false, nil
+}
+
+// CheckHashAndRehash is like CheckHash, except that when the password matches and hash
+// was created with parameters weaker than desired, it also returns a freshly computed
+// hash of password using desired so the caller can persist it and gradually upgrade
+// stored hashes as desired parameters are tightened over time. newHash is empty when
+// no rehash is needed or the password didn't match.
+func CheckHashAndRehash(password, secret, hash string, desired *Params) (match bool, newHash string, err error) {
+	argon2Variant, params, salt, key, err := DecodeHash(hash)
+	if err != nil {
+		return false, "", err
+	}
+
+	otherKey := computeKey(argon2Variant, []byte(password), []byte(secret), salt, params)
+
+	keyLen := int32(len(key))
+	otherKeyLen := int32(len(otherKey))
+
+	if subtle.ConstantTimeEq(keyLen, otherKeyLen) == 0 || subtle.ConstantTimeCompare(key, otherKey) == 0 {
+		return false, "", nil
+	}
+
+	needsRehash := params.Memory < desired.Memory ||
+		params.Iterations < desired.Iterations ||
+		params.Parallelism < desired.Parallelism ||
+		params.SaltLength < desired.SaltLength ||
+		params.KeyLength < desired.KeyLength
+	if !needsRehash {
+		return true, "", nil
+	}
+
+	switch argon2Variant {
+	case Argon2i:
+		newHash, err = CreateHash(password, secret, desired)
+	case Argon2id:
+		newHash, err = IDCreateHash(password, secret, desired)
+	case Argon2d:
+		newHash, err = DCreateHash(password, secret, desired)
+	}
+	if err != nil {
+		return true, "", err
+	}
+	return true, newHash, nil
+}
+
 // DecodeHash expects a hash created from this package, and parses it to return the params used to
 // create it, as well as the variant of argon2, salt and key (password hash).
-func DecodeHash(hash string) (argon2Variant int, params *Params, salt, key []byte, err error) {
-	argon2Variant = -1 // incompatible variant
+func DecodeHash(hash string) (argon2Variant Variant, params *Params, salt, key []byte, err error) {
+	argon2Variant = invalidVariant
 
 	vals := strings.Split(hash, "$")
 	if len(vals) != 6 {
 		return argon2Variant, nil, nil, nil, ErrInvalidHash
 	}
 
-	if vals[1] != "argon2i" && vals[1] != "argon2id" {
+	switch vals[1] {
+	case "argon2i":
+		argon2Variant = Argon2i
+	case "argon2id":
+		argon2Variant = Argon2id
+	case "argon2d":
+		argon2Variant = Argon2d
+	default:
 		return argon2Variant, nil, nil, nil, ErrIncompatibleVariant
 	}
-	if vals[1] == "argon2i" {
-		argon2Variant = argon2i
-	}
-	if vals[1] == "argon2id" {
-		argon2Variant = argon2id
-	}
 
 	var version int
 	_, err = fmt.Sscanf(vals[2], "v=%d", &version)
@@ -267,6 +463,23 @@ func DecodeHash(hash string) (argon2Variant int, params *Params, salt, key []byt
 		return argon2Variant, nil, nil, nil, err
 	}
 
+	if idx := strings.Index(vals[3], ",keyid="); idx != -1 {
+		encoded := vals[3][idx+len(",keyid="):]
+		if end := strings.Index(encoded, ","); end != -1 {
+			encoded = encoded[:end]
+		}
+		params.KeyID, err = base64.RawStdEncoding.Strict().DecodeString(encoded)
+		if err != nil {
+			return argon2Variant, nil, nil, nil, err
+		}
+	}
+	if idx := strings.Index(vals[3], ",data="); idx != -1 {
+		params.AssociatedData, err = base64.RawStdEncoding.Strict().DecodeString(vals[3][idx+len(",data="):])
+		if err != nil {
+			return argon2Variant, nil, nil, nil, err
+		}
+	}
+
 	salt, err = base64.RawStdEncoding.Strict().DecodeString(vals[4])
 	if err != nil {
 		return argon2Variant, nil, nil, nil, err
@@ -0,0 +1,148 @@
+// Package passhash identifies and verifies PHC-formatted password hashes
+// produced by several different algorithms, so that applications migrating
+// away from a legacy password store (as Ory Kratos and passlib do) can
+// accept whatever hash format is already on file and re-hash with Argon2id
+// the next time the plaintext password is available.
+package passhash
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pilinux/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// ErrIncompatibleVariant is returned by Verify if hash doesn't start with a
+// prefix this package recognizes.
+var ErrIncompatibleVariant = errors.New("passhash: incompatible variant of password hash")
+
+// ErrInvalidHash is returned by Verify if hash starts with a recognized
+// prefix but isn't otherwise in the expected format for that algorithm.
+var ErrInvalidHash = errors.New("passhash: hash is not in the correct format")
+
+// Verify identifies which algorithm hash was produced with from its PHC-style
+// prefix, verifies password against it, and reports whether the caller
+// should migrate the stored hash to Argon2id now that it has password in
+// plaintext. secret is only meaningful for the Argon2 variants, which are
+// verified via this module's argon2 package; bcrypt, scrypt and PBKDF2
+// predate the concept of a secret/pepper and ignore it.
+//
+// Recognized prefixes:
+//   - $2a$, $2b$, $2y$   bcrypt
+//   - $scrypt$           scrypt
+//   - $pbkdf2-sha256$    PBKDF2-HMAC-SHA256
+//   - $argon2i$, $argon2id$, $argon2d$   Argon2
+//
+// $7$, passlib's crypt-style scrypt encoding, is deliberately NOT recognized:
+// it packs N/r/p using passlib's own custom base64 alphabet rather than
+// three raw bytes, and without a real passlib-generated vector to verify
+// against, decoding it would risk silently deriving the wrong key and
+// reporting a mismatch indistinguishable from a wrong password. A $7$ hash
+// falls through to ErrIncompatibleVariant below instead.
+//
+// needsMigration is true when password matches a hash of any algorithm other
+// than argon2id (argon2i and argon2d included); it is false for argon2id and
+// whenever password does not match.
+func Verify(password, secret, hash string) (match bool, needsMigration bool, err error) {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		match, err = verifyBcrypt(password, hash)
+		return match, match, err
+	case strings.HasPrefix(hash, "$scrypt$"):
+		match, err = verifyScrypt(password, hash)
+		return match, match, err
+	case strings.HasPrefix(hash, "$pbkdf2-sha256$"):
+		match, err = verifyPBKDF2(password, hash)
+		return match, match, err
+	case strings.HasPrefix(hash, "$argon2id$"):
+		match, err = argon2.ComparePasswordAndHash(password, secret, hash)
+		return match, false, err
+	case strings.HasPrefix(hash, "$argon2i$"), strings.HasPrefix(hash, "$argon2d$"):
+		match, err = argon2.ComparePasswordAndHash(password, secret, hash)
+		return match, match, err
+	default:
+		return false, false, ErrIncompatibleVariant
+	}
+}
+
+// verifyBcrypt reports whether password matches a bcrypt hash. bcrypt has no
+// concept of a secret/pepper, so secret is always ignored.
+func verifyBcrypt(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// verifyScrypt reports whether password matches a $scrypt$ PHC-encoded hash:
+//
+//	$scrypt$ln=<log2N>,r=<r>,p=<p>$<salt>$<hash>
+func verifyScrypt(password, hash string) (bool, error) {
+	logN, r, p, salt, key, err := decodeScryptHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	otherKey, err := scrypt.Key([]byte(password), salt, 1<<logN, r, p, len(key))
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
+
+func decodeScryptHash(hash string) (logN, r, p int, salt, key []byte, err error) {
+	vals := strings.Split(hash, "$")
+	if len(vals) != 5 {
+		return 0, 0, 0, nil, nil, ErrInvalidHash
+	}
+	if _, err = fmt.Sscanf(vals[2], "ln=%d,r=%d,p=%d", &logN, &r, &p); err != nil {
+		return 0, 0, 0, nil, nil, ErrInvalidHash
+	}
+	if salt, err = base64.RawStdEncoding.Strict().DecodeString(vals[3]); err != nil {
+		return 0, 0, 0, nil, nil, ErrInvalidHash
+	}
+	if key, err = base64.RawStdEncoding.Strict().DecodeString(vals[4]); err != nil {
+		return 0, 0, 0, nil, nil, ErrInvalidHash
+	}
+	return logN, r, p, salt, key, nil
+}
+
+// verifyPBKDF2 reports whether password matches a passlib-style
+// $pbkdf2-sha256$<rounds>$<salt>$<hash> hash.
+func verifyPBKDF2(password, hash string) (bool, error) {
+	vals := strings.Split(hash, "$")
+	if len(vals) != 5 {
+		return false, ErrInvalidHash
+	}
+
+	rounds, err := strconv.Atoi(vals[2])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.Strict().DecodeString(vals[3])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.Strict().DecodeString(vals[4])
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+
+	otherKey := pbkdf2.Key([]byte(password), salt, rounds, len(key), sha256.New)
+	return subtle.ConstantTimeCompare(key, otherKey) == 1, nil
+}
@@ -0,0 +1,119 @@
+package passhash
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/pilinux/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+func TestVerifyBcrypt(t *testing.T) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte("pa$$word"), bcrypt.DefaultCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, needsMigration, err := Verify("pa$$word", "ignored-secret", string(hashed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("expected password and hash to match")
+	}
+	if !needsMigration {
+		t.Error("expected bcrypt hash to require migration")
+	}
+
+	match, _, err = Verify("otherPa$$word", "", string(hashed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match {
+		t.Error("expected password and hash to not match")
+	}
+}
+
+func TestVerifyScrypt(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	const logN, r, p, keyLen = 14, 8, 1, 32
+
+	key, err := scrypt.Key([]byte("pa$$word"), salt, 1<<logN, r, p, keyLen)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", logN, r, p,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	match, needsMigration, err := Verify("pa$$word", "", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("expected password and hash to match")
+	}
+	if !needsMigration {
+		t.Error("expected scrypt hash to require migration")
+	}
+}
+
+func TestVerifyPBKDF2(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	const rounds, keyLen = 29000, 32
+
+	key := pbkdf2.Key([]byte("pa$$word"), salt, rounds, keyLen, sha256.New)
+	hash := fmt.Sprintf("$pbkdf2-sha256$%d$%s$%s", rounds,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+
+	match, needsMigration, err := Verify("pa$$word", "", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("expected password and hash to match")
+	}
+	if !needsMigration {
+		t.Error("expected PBKDF2 hash to require migration")
+	}
+}
+
+func TestVerifyArgon2(t *testing.T) {
+	hash, err := argon2.IDCreateHash("pa$$word", "$â‚¬crâ‚¬t", argon2.DefaultParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, needsMigration, err := Verify("pa$$word", "$â‚¬crâ‚¬t", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !match {
+		t.Error("expected password and hash to match")
+	}
+	if needsMigration {
+		t.Error("expected argon2id hash to not require migration")
+	}
+}
+
+func TestVerifyUnknownVariant(t *testing.T) {
+	_, _, err := Verify("pa$$word", "", "$unknown$abc")
+	if err != ErrIncompatibleVariant {
+		t.Fatalf("expected error %s", ErrIncompatibleVariant)
+	}
+}
+
+// TestVerifyCryptScryptRejected confirms that the "$7$" crypt-style scrypt
+// encoding (passlib's own custom N/r/p packing, distinct from the $scrypt$
+// PHC encoding this package actually implements) is reported as an
+// incompatible variant rather than silently decoded into the wrong key.
+func TestVerifyCryptScryptRejected(t *testing.T) {
+	_, _, err := Verify("pa$$word", "", "$7$DU..../....3XqVcE6a4jI5NvA.hKjgSLGypYMXO8Q$hash")
+	if err != ErrIncompatibleVariant {
+		t.Fatalf("expected error %s, got %v", ErrIncompatibleVariant, err)
+	}
+}